@@ -0,0 +1,115 @@
+package servicemanager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-ps"
+
+	"sm2/ledger"
+)
+
+// serviceNameMarker is the jvm arg sm.run already injects into every
+// service it starts; adoptOrphans looks for it in other processes'
+// command lines when a StateFile's own Pid can't be trusted.
+func serviceNameMarker(serviceId string) string {
+	return fmt.Sprintf("-Dservice.manager.serviceName=%s", serviceId)
+}
+
+// AdoptOrphans must be called once, right after a ServiceManager is
+// constructed and before it's handed to callers. If sm2 itself was
+// restarted, a StateFile.Pid may now belong to an unrelated process (the
+// OS recycles pids), or a service sm2 thinks isn't running may actually
+// still be up. For each known service we check the recorded pid is both
+// alive and still running out of its installFile.Path before trusting it;
+// if not, we fall back to scanning all processes for the
+// service.manager.serviceName marker we stamp onto every command line in
+// run() and adopt whichever one matches into a fresh StateFile.
+func (sm ServiceManager) AdoptOrphans() {
+	for name, service := range sm.Services {
+		installDir, _ := sm.findInstallDirOfService(name)
+
+		installFile, err := sm.Ledger.LoadInstallFile(installDir)
+		if err != nil {
+			continue
+		}
+
+		state, err := sm.Ledger.LoadStateFile(installDir)
+		if err == nil && processMatchesInstall(state.Pid, installFile) {
+			// recorded pid is still the one we started, nothing to do
+			continue
+		}
+
+		adopted, ok := findOrphanByMarker(service.Id)
+		if !ok {
+			if err == nil {
+				// we had a StateFile but it's stale and no live process matches
+				sm.PrintVerbose(fmt.Sprintf("%s's recorded pid %d is gone, marking as stopped", name, state.Pid))
+				sm.Ledger.DeleteStateFile(installDir)
+			}
+			continue
+		}
+
+		sm.PrintVerbose(fmt.Sprintf("adopted orphaned %s running as pid %d", name, adopted))
+
+		newState := ledger.StateFile{
+			Service:  service.Id,
+			Artifact: service.Binary.Artifact,
+			Version:  installFile.Version,
+			Path:     installFile.Path,
+			Md5Sum:   installFile.Md5Sum,
+			Started:  time.Now(),
+			Pid:      adopted,
+			Port:     service.DefaultPort,
+		}
+		sm.Ledger.SaveStateFile(installDir, newState)
+	}
+}
+
+// processMatchesInstall confirms pid is alive and its executable path
+// starts with installFile.Path, rather than just trusting a recycled pid.
+// It is a prefix check on the install directory only: the path is not
+// compared against bin/<runCmd>. Where the executable path can't be read,
+// the pid is trusted.
+func processMatchesInstall(pid int, installFile ledger.InstallFile) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	proc, err := ps.FindProcess(pid)
+	if err != nil || proc == nil {
+		return false
+	}
+
+	exe, err := executablePath(pid)
+	if err != nil {
+		// can't confirm the executable path on this platform/process - trust the pid
+		return true
+	}
+
+	return strings.HasPrefix(exe, installFile.Path)
+}
+
+// findOrphanByMarker scans all processes for one whose command line
+// contains the service.manager.serviceName marker sm2 stamps onto every
+// service it launches.
+func findOrphanByMarker(serviceId string) (int, bool) {
+	processes, err := ps.Processes()
+	if err != nil {
+		return 0, false
+	}
+
+	marker := serviceNameMarker(serviceId)
+	for _, proc := range processes {
+		cmdline, err := commandLine(proc.Pid())
+		if err != nil {
+			continue
+		}
+		if strings.Contains(cmdline, marker) {
+			return proc.Pid(), true
+		}
+	}
+
+	return 0, false
+}
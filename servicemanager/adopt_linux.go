@@ -0,0 +1,25 @@
+//go:build linux
+
+package servicemanager
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// executablePath resolves /proc/<pid>/exe, which is a symlink to the
+// binary the process was started from.
+func executablePath(pid int) (string, error) {
+	return os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+}
+
+// commandLine reads /proc/<pid>/cmdline, which is NUL-separated rather
+// than space-separated.
+func commandLine(pid int) (string, error) {
+	raw, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(string(raw), "\x00", " "), nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !windows
+
+package servicemanager
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// executablePath and commandLine have no implementation outside Linux and
+// Windows; they are stubbed here so the package still builds on e.g.
+// darwin. processMatchesInstall treats the error as "can't confirm" and
+// trusts the recorded pid; findOrphanByMarker skips every process, so no
+// orphan is ever found by marker on these platforms.
+func executablePath(pid int) (string, error) {
+	return "", fmt.Errorf("executablePath not yet implemented on %s", runtime.GOOS)
+}
+
+func commandLine(pid int) (string, error) {
+	return "", fmt.Errorf("commandLine not yet implemented on %s", runtime.GOOS)
+}
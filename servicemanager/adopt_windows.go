@@ -0,0 +1,103 @@
+//go:build windows
+
+package servicemanager
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// executablePath asks Windows for the full path of the executable pid was
+// started from, via QueryFullProcessImageName.
+func executablePath(pid int) (string, error) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return "", fmt.Errorf("failed to open process %d: %s", pid, err)
+	}
+	defer windows.CloseHandle(h)
+
+	buf := make([]uint16, windows.MAX_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(h, 0, &buf[0], &size); err != nil {
+		return "", fmt.Errorf("failed to query image path for pid %d: %s", pid, err)
+	}
+
+	return windows.UTF16ToString(buf[:size]), nil
+}
+
+// processBasicInformation mirrors PROCESS_BASIC_INFORMATION as filled in
+// by NtQueryInformationProcess; only PebBaseAddress is needed here.
+type processBasicInformation struct {
+	ExitStatus                   uintptr
+	PebBaseAddress               uintptr
+	AffinityMask                 uintptr
+	BasePriority                 uintptr
+	UniqueProcessId              uintptr
+	InheritedFromUniqueProcessId uintptr
+}
+
+var (
+	ntdll                         = windows.NewLazySystemDLL("ntdll.dll")
+	procNtQueryInformationProcess = ntdll.NewProc("NtQueryInformationProcess")
+)
+
+// unicodeString mirrors UNICODE_STRING, used for
+// RTL_USER_PROCESS_PARAMETERS.CommandLine in the target process's PEB.
+type unicodeString struct {
+	Length        uint16
+	MaximumLength uint16
+	_             uint32 // padding so Buffer lands 8-byte aligned on amd64
+	Buffer        uintptr
+}
+
+// commandLine reads pid's command line out of its PEB via
+// ReadProcessMemory: NtQueryInformationProcess gives us the PEB address,
+// PEB+0x20 holds ProcessParameters, and
+// RTL_USER_PROCESS_PARAMETERS+0x70 holds the CommandLine UNICODE_STRING.
+// Those offsets are amd64-specific - this doesn't handle reading a 32-bit
+// process's PEB from a 64-bit sm2 (WOW64), which isn't a setup sm2 targets.
+func commandLine(pid int) (string, error) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_INFORMATION|windows.PROCESS_VM_READ, false, uint32(pid))
+	if err != nil {
+		return "", fmt.Errorf("failed to open process %d: %s", pid, err)
+	}
+	defer windows.CloseHandle(h)
+
+	var info processBasicInformation
+	var retLen uint32
+	status, _, _ := procNtQueryInformationProcess.Call(
+		uintptr(h), 0, uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info), uintptr(unsafe.Pointer(&retLen)),
+	)
+	if status != 0 {
+		return "", fmt.Errorf("NtQueryInformationProcess failed for pid %d: status %#x", pid, status)
+	}
+
+	const processParametersOffset = 0x20
+	var paramsAddr uintptr
+	if err := readProcessMemory(h, info.PebBaseAddress+processParametersOffset, (*byte)(unsafe.Pointer(&paramsAddr)), unsafe.Sizeof(paramsAddr)); err != nil {
+		return "", fmt.Errorf("failed to read PEB for pid %d: %s", pid, err)
+	}
+
+	const commandLineOffset = 0x70
+	var cmdLine unicodeString
+	if err := readProcessMemory(h, paramsAddr+commandLineOffset, (*byte)(unsafe.Pointer(&cmdLine)), unsafe.Sizeof(cmdLine)); err != nil {
+		return "", fmt.Errorf("failed to read process parameters for pid %d: %s", pid, err)
+	}
+	if cmdLine.Length == 0 {
+		return "", nil
+	}
+
+	buf := make([]uint16, cmdLine.Length/2)
+	if err := readProcessMemory(h, cmdLine.Buffer, (*byte)(unsafe.Pointer(&buf[0])), uintptr(cmdLine.Length)); err != nil {
+		return "", fmt.Errorf("failed to read command line for pid %d: %s", pid, err)
+	}
+
+	return windows.UTF16ToString(buf), nil
+}
+
+func readProcessMemory(h windows.Handle, addr uintptr, buf *byte, size uintptr) error {
+	var read uintptr
+	return windows.ReadProcessMemory(h, addr, buf, size, &read)
+}
@@ -0,0 +1,12 @@
+package servicemanager
+
+// ServiceBackend records how a running service was launched, so StopService
+// and the supervisor/updater know whether to signal a raw pid or go through
+// the platform's service manager instead.
+type ServiceBackend string
+
+const (
+	BackendProcess     ServiceBackend = "process"
+	BackendWindowsSvc  ServiceBackend = "windows-service"
+	BackendSystemdUnit ServiceBackend = "systemd-unit"
+)
@@ -0,0 +1,24 @@
+//go:build !linux && !windows
+
+package servicemanager
+
+import (
+	"fmt"
+	"runtime"
+
+	"sm2/ledger"
+)
+
+// runManaged has no platform service-manager backend outside Linux
+// (systemd-unit) and Windows (windows-service) yet, so --as-service just
+// fails cleanly here instead of silently falling back to a bare process.
+func (sm ServiceManager) runManaged(service Service, installFile ledger.InstallFile, portNumber int) (ledger.StateFile, error) {
+	return ledger.StateFile{}, fmt.Errorf("--as-service is not supported on %s", runtime.GOOS)
+}
+
+// stopManaged is unreachable here: a StateFile can only carry a
+// non-process Backend if it was started through runManaged, which always
+// fails on this platform before a StateFile is ever saved.
+func stopManaged(backend ServiceBackend, serviceId string) error {
+	return fmt.Errorf("unknown service backend %q on %s", backend, runtime.GOOS)
+}
@@ -0,0 +1,78 @@
+package servicemanager
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Checksums holds both digests we keep for an install. Only Sha256 is
+// compared against what artifactory publishes; Md5 is recorded in the
+// ledger but never checked against an artifactory md5.
+type Checksums struct {
+	Sha256 string
+	Md5    string
+}
+
+// hashFile computes the sha256 and md5 digests of the file at p in a single
+// pass.
+func hashFile(p string) (Checksums, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return Checksums{}, err
+	}
+	defer f.Close()
+
+	sha := sha256.New()
+	md := md5.New()
+
+	if _, err := io.Copy(io.MultiWriter(sha, md), f); err != nil {
+		return Checksums{}, err
+	}
+
+	return Checksums{
+		Sha256: hex.EncodeToString(sha.Sum(nil)),
+		Md5:    hex.EncodeToString(md.Sum(nil)),
+	}, nil
+}
+
+// fetchExpectedChecksum asks artifactory for the checksum of downloadUrl,
+// preferring the X-Checksum-Sha256 response header artifactory sets on a
+// HEAD request and falling back to the sibling ".sha256" file it publishes
+// alongside every artifact.
+func fetchExpectedChecksum(downloadUrl string) (string, error) {
+	resp, err := http.Head(downloadUrl)
+	if err == nil {
+		defer resp.Body.Close()
+		if checksum := resp.Header.Get("X-Checksum-Sha256"); checksum != "" {
+			return checksum, nil
+		}
+	}
+
+	resp, err = http.Get(downloadUrl + ".sha256")
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch checksum for %s: %s", downloadUrl, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("no checksum published for %s (status %d)", downloadUrl, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	// artifactory's .sha256 files are "<hash>  <filename>", the hash is all we want
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty checksum file for %s", downloadUrl)
+	}
+	return fields[0], nil
+}
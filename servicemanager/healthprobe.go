@@ -0,0 +1,153 @@
+package servicemanager
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"sm2/ledger"
+)
+
+// defaultProbeInterval and defaultProbeTimeout are used when a service's
+// HealthCheck leaves its own Interval or Timeout unset.
+const defaultProbeInterval = 10 * time.Second
+const defaultProbeTimeout = 5 * time.Second
+
+// defaultFailureThreshold is how many consecutive failed probes it takes
+// before a service is marked unhealthy.
+const defaultFailureThreshold = 3
+
+// probeHealth repeatedly issues HTTP GETs against the service's configured
+// health endpoint after it starts, in addition to the one-off
+// CheckHealth(port) done before StartService installs/runs anything. A TCP
+// accept doesn't mean the application is actually serving - this catches
+// the gap where a JVM has bound the port but is still booting.
+func (sm ServiceManager) probeHealth(service Service, installDir string, port int, stop <-chan struct{}) {
+	check := service.HealthCheck
+	if check.Path == "" {
+		// nothing configured for this service, nothing to probe
+		return
+	}
+
+	interval := check.Interval
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	threshold := check.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+
+	var bodyPattern *regexp.Regexp
+	if check.BodyPattern != "" {
+		bodyPattern, _ = regexp.Compile(check.BodyPattern)
+	}
+
+	client := &http.Client{Timeout: timeout}
+	url := fmt.Sprintf("http://localhost:%d%s", port, check.Path)
+
+	consecutiveFailures := 0
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if probeOnce(client, url, check.ExpectedStatus, bodyPattern) {
+				consecutiveFailures = 0
+			} else {
+				consecutiveFailures++
+			}
+
+			sm.saveHealthState(installDir, ledger.HealthState{
+				Healthy:           consecutiveFailures < threshold,
+				ConsecutiveFailed: consecutiveFailures,
+				Threshold:         threshold,
+			})
+
+			if consecutiveFailures == threshold {
+				sm.UiUpdates <- Progress{service: service.Id, state: fmt.Sprintf("Unhealthy (%d/%d consecutive failures)", consecutiveFailures, threshold)}
+
+				if sm.Commands.RestartUnhealthy {
+					sm.restartUnhealthyService(service, installDir)
+					return
+				}
+			}
+		}
+	}
+}
+
+func probeOnce(client *http.Client, url string, expectedStatus int, bodyPattern *regexp.Regexp) bool {
+	resp, err := client.Get(url)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	wantStatus := expectedStatus
+	if wantStatus == 0 {
+		wantStatus = http.StatusOK
+	}
+	if resp.StatusCode != wantStatus {
+		return false
+	}
+
+	if bodyPattern == nil {
+		return true
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return false
+	}
+	return bodyPattern.Match(body)
+}
+
+// restartUnhealthyService kills the current process and restarts it via a
+// fresh sm.run, which re-arms both the supervisor (if --supervise is set)
+// and a new probeHealth goroutine. It always does the restart itself
+// rather than leaning on the supervisor to notice the exit: safeStop
+// already signals the old supervisor goroutine to step aside (see
+// stopSupervisor), so nothing else would bring the process back up.
+func (sm ServiceManager) restartUnhealthyService(service Service, installDir string) {
+	state, err := sm.Ledger.LoadStateFile(installDir)
+	if err != nil {
+		return
+	}
+
+	if err := sm.safeStop(state); err != nil {
+		sm.UiUpdates <- Progress{service: service.Id, state: "Failed to stop unhealthy service: " + err.Error()}
+		return
+	}
+
+	installFile, err := sm.Ledger.LoadInstallFile(installDir)
+	if err != nil {
+		return
+	}
+
+	newState, err := sm.run(service, installFile, installDir)
+	if err != nil {
+		sm.UiUpdates <- Progress{service: service.Id, state: "Restart after unhealthy check failed: " + err.Error()}
+		return
+	}
+
+	sm.Ledger.SaveStateFile(installDir, newState)
+}
+
+func (sm ServiceManager) saveHealthState(installDir string, health ledger.HealthState) {
+	state, err := sm.Ledger.LoadStateFile(installDir)
+	if err != nil {
+		return
+	}
+	state.Health = health
+	sm.Ledger.SaveStateFile(installDir, state)
+}
@@ -42,11 +42,21 @@ func (sm ServiceManager) StartService(serviceName string, requestedVersion strin
 		versionToInstall = versions.Latest
 	}
 
+	// if the caller asked for a version we already have on disk, use it directly
+	// and skip the download path entirely
+	if sm.Commands.UseInstalled != "" {
+		installed, err := sm.Ledger.LoadInstallFileVersion(installDir, sm.Commands.UseInstalled)
+		if err != nil {
+			return fmt.Errorf("%s@%s is not installed: %s", serviceName, sm.Commands.UseInstalled, err)
+		}
+		return sm.startFromInstallFile(serviceName, service, installDir, installed)
+	}
+
 	// install requested version of service if required
 	isInstalled := false
 	installFile, err := sm.Ledger.LoadInstallFile(installDir)
 	if err == nil {
-		isInstalled = verifyInstall(installFile, service.Id, versionToInstall, offline)
+		isInstalled = verifyInstall(installFile, service.Id, versionToInstall, offline, sm.Commands.NoVerify)
 	}
 
 	if !isInstalled || sm.Commands.Clean {
@@ -66,28 +76,41 @@ func (sm ServiceManager) StartService(serviceName string, requestedVersion strin
 		}
 	}
 
+	return sm.startFromInstallFile(serviceName, service, installDir, installFile)
+}
+
+// startFromInstallFile prepares logs and launches an already-resolved
+// install (downloaded just now, or picked via --use-installed).
+func (sm ServiceManager) startFromInstallFile(serviceName string, service Service, installDir string, installFile ledger.InstallFile) error {
 	// re-init log dirs
-	_, err = initLogDir(installFile.Path)
-	if err != nil {
+	if _, err := initLogDir(installFile.Path); err != nil {
 		return err
 	}
 
 	// start the service
 	sm.UiUpdates <- Progress{service: serviceName, percent: 100, state: "Starting..."}
-	state, err := sm.run(service, installFile)
+	state, err := sm.run(service, installFile, installDir)
 	if err != nil {
 		return err
 	}
 
-	return sm.Ledger.SaveStateFile(installDir, state)
+	if err := sm.Ledger.SaveStateFile(installDir, state); err != nil {
+		return err
+	}
+
+	if sm.Commands.Watch {
+		go sm.RunUpdater(sm.Stop)
+	}
+
+	return nil
 }
 
 func (sm ServiceManager) installService(installDir string, service Service, version string) (ledger.InstallFile, error) {
 
 	var installFile ledger.InstallFile
 
-	err := removeExistingVersions(installDir)
-	if err != nil {
+	versionDir := path.Join(installDir, version)
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
 		return installFile, err
 	}
 
@@ -103,26 +126,64 @@ func (sm ServiceManager) installService(installDir string, service Service, vers
 		update:  sm.UiUpdates,
 	}
 
-	serviceDir, err := sm.downloadAndDecompress(downloadUrl, installDir, &progressTracker)
+	serviceDir, err := sm.downloadAndDecompress(downloadUrl, versionDir, &progressTracker)
 	if err != nil {
-		return installFile, fmt.Errorf("failed to find service directory in %s: %s", installDir, err)
+		return installFile, fmt.Errorf("failed to find service directory in %s: %s", versionDir, err)
+	}
+
+	checksums, err := hashFile(path.Join(serviceDir, filename))
+	if err != nil {
+		if !sm.Commands.NoVerify {
+			return installFile, fmt.Errorf("could not hash downloaded artifact for %s: %s", service.Id, err)
+		}
+		// --no-verify: proceed without a recorded checksum rather than
+		// failing an install the user explicitly asked not to verify
+		sm.PrintVerbose(fmt.Sprintf("could not hash downloaded artifact for %s: %s", service.Id, err))
+	} else if !sm.Commands.NoVerify {
+		expected, err := fetchExpectedChecksum(downloadUrl)
+		if err != nil {
+			return installFile, fmt.Errorf("could not verify checksum for %s: %s", service.Id, err)
+		}
+		if expected != checksums.Sha256 {
+			return installFile, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", service.Id, expected, checksums.Sha256)
+		}
+	}
+
+	if err := updateCurrentSymlink(installDir, serviceDir); err != nil {
+		return installFile, fmt.Errorf("failed to point current at %s: %s", serviceDir, err)
 	}
 
 	installFile = ledger.InstallFile{
-		Service:  service.Id,
-		Artifact: service.Binary.Artifact,
-		Version:  version,
-		Path:     serviceDir,
-		Md5Sum:   "TODO",
-		Created:  time.Now(),
+		Service:      service.Id,
+		Artifact:     service.Binary.Artifact,
+		Version:      version,
+		Path:         serviceDir,
+		ArtifactFile: path.Join(serviceDir, filename),
+		Sha256:       checksums.Sha256,
+		Md5Sum:       checksums.Md5,
+		Created:      time.Now(),
 	}
 
-	err = sm.Ledger.SaveInstallFile(installDir, installFile)
-	return installFile, err
+	if err := sm.Ledger.SaveInstallFile(installDir, installFile); err != nil {
+		return installFile, err
+	}
+
+	keep := sm.Commands.KeepVersions
+	if keep <= 0 {
+		keep = defaultKeepVersions
+	}
+	if err := sm.gcOldVersions(installDir, keep); err != nil {
+		sm.PrintVerbose(fmt.Sprintf("failed to garbage-collect old versions of %s: %s", service.Id, err))
+	}
+
+	return installFile, nil
 }
 
 // Given a service (config) and an installFile (code) run the service.
-func (sm ServiceManager) run(service Service, installFile ledger.InstallFile) (ledger.StateFile, error) {
+// installDir is the on-disk parent directory the ledger keys this service's
+// InstallFile/StateFile under, and is threaded through so a --supervise
+// restart can re-read and re-save state against the same key.
+func (sm ServiceManager) run(service Service, installFile ledger.InstallFile, installDir string) (ledger.StateFile, error) {
 
 	serviceDir := installFile.Path
 	version := installFile.Version
@@ -134,22 +195,20 @@ func (sm ServiceManager) run(service Service, installFile ledger.InstallFile) (l
 		portNumber = sm.Commands.Port
 	}
 
-	// add service-manager generated args
-	smArgs := []string{
-		fmt.Sprintf("-Dservice.manager.serviceName=%s", service.Id),
-		fmt.Sprintf("-Dservice.manager.runFrom=%s", version),
-		fmt.Sprintf("-Duser.home=%s", path.Join(serviceDir, "..")),
-		fmt.Sprintf("-Dhttp.port=%d", portNumber),
-	}
+	if sm.Commands.AsService {
+		state, err := sm.runManaged(service, installFile, portNumber)
+		if err != nil {
+			return ledger.StateFile{}, err
+		}
 
-	args := append(service.Binary.Cmd[1:], smArgs...)
+		if service.HealthCheck.Path != "" {
+			go sm.probeHealth(service, installDir, portNumber, sm.Stop)
+		}
 
-	// add user supplied args
-	if userArgs, ok := sm.Commands.ExtraArgs[service.Id]; ok {
-		args = append(args, userArgs...)
+		return state, nil
 	}
 
-	logFile, err := os.Create(path.Join(serviceDir, "logs", "stdout.log"))
+	args, logFile, err := sm.prepareRun(service, installFile, portNumber, false)
 	if err != nil {
 		return ledger.StateFile{}, err
 	}
@@ -173,17 +232,73 @@ func (sm ServiceManager) run(service Service, installFile ledger.InstallFile) (l
 		Artifact: service.Binary.Artifact,
 		Version:  version,
 		Path:     serviceDir,
-		Md5Sum:   "TODO",
+		Md5Sum:   installFile.Md5Sum,
 		Started:  time.Now(),
 		Pid:      cmd.Process.Pid,
 		Port:     portNumber,
 		Args:     args,
 	}
 
+	if sm.Commands.Supervise {
+		stop := registerSupervisor(service.Id)
+		go sm.supervise(service, installFile, installDir, cmd, stop)
+	}
+
+	if service.HealthCheck.Path != "" {
+		go sm.probeHealth(service, installDir, portNumber, sm.Stop)
+	}
+
 	return state, nil
 }
 
-func verifyInstall(installFile ledger.InstallFile, service string, version string, offline bool) bool {
+// buildArgs assembles the argument list a service is launched with,
+// whatever actually execs it: run()/restart() spawning a bare child
+// process, or runManaged handing the same command line to the platform
+// service manager (SCM, systemd). Keeping this in one place is what lets
+// adopt.go's marker-based scan find a service regardless of which backend
+// started it.
+func (sm ServiceManager) buildArgs(service Service, installFile ledger.InstallFile, portNumber int) []string {
+	serviceDir := installFile.Path
+	version := installFile.Version
+
+	smArgs := []string{
+		serviceNameMarker(service.Id),
+		fmt.Sprintf("-Dservice.manager.runFrom=%s", version),
+		fmt.Sprintf("-Duser.home=%s", path.Join(serviceDir, "..")),
+		fmt.Sprintf("-Dhttp.port=%d", portNumber),
+	}
+
+	args := append(service.Binary.Cmd[1:], smArgs...)
+
+	if userArgs, ok := sm.Commands.ExtraArgs[service.Id]; ok {
+		args = append(args, userArgs...)
+	}
+
+	return args
+}
+
+// prepareRun builds the argument list for a service and opens its stdout
+// log, truncating it on a fresh start or appending when a supervised
+// restart needs the history to survive.
+func (sm ServiceManager) prepareRun(service Service, installFile ledger.InstallFile, portNumber int, appendLog bool) ([]string, *os.File, error) {
+	serviceDir := installFile.Path
+	args := sm.buildArgs(service, installFile, portNumber)
+
+	var logFile *os.File
+	var err error
+	if appendLog {
+		logFile, err = reopenStdout(serviceDir)
+	} else {
+		logFile, err = os.Create(path.Join(serviceDir, "logs", "stdout.log"))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return args, logFile, nil
+}
+
+func verifyInstall(installFile ledger.InstallFile, service string, version string, offline bool, noVerify bool) bool {
 
 	// verify its the right one
 	if installFile.Service != service {
@@ -201,8 +316,52 @@ func verifyInstall(installFile ledger.InstallFile, service string, version strin
 		return false
 	}
 
-	// TODO: verify hashes etc...
-	return true
+	if noVerify {
+		// the user asked us not to bother
+		return true
+	}
+
+	if installFile.Sha256 == "" || installFile.ArtifactFile == "" {
+		// nothing recorded to verify against - that's not the same as
+		// having verified it, so don't silently trust the install
+		return false
+	}
+
+	if _, err := os.Stat(installFile.ArtifactFile); os.IsNotExist(err) {
+		// the downloaded artifact was cleaned up after extraction - nothing
+		// left on disk to compare against, so we can't confirm this install
+		// hasn't been tampered with or corrupted
+		return false
+	}
+
+	checksums, err := hashFile(installFile.ArtifactFile)
+	if err != nil {
+		return false
+	}
+
+	return checksums.Sha256 == installFile.Sha256
+}
+
+// VerifyService re-checks the recorded checksum for an installed service
+// against what's on disk, for `sm2 verify <service>` auditing. It does not
+// consult --no-verify since the whole point of the command is to check.
+func (sm ServiceManager) VerifyService(serviceName string) error {
+	service, ok := sm.Services[serviceName]
+	if !ok {
+		return fmt.Errorf("%s is not a valid service", serviceName)
+	}
+
+	installDir, _ := sm.findInstallDirOfService(serviceName)
+	installFile, err := sm.Ledger.LoadInstallFile(installDir)
+	if err != nil {
+		return fmt.Errorf("%s is not installed", serviceName)
+	}
+
+	if !verifyInstall(installFile, service.Id, installFile.Version, false, false) {
+		return fmt.Errorf("%s@%s failed checksum verification", serviceName, installFile.Version)
+	}
+
+	return nil
 }
 
 // clears exists logs and creates the folder if its missing
@@ -226,19 +385,3 @@ func removeRunningPid(serviceDir string) {
 		os.Remove(pidPath)
 	}
 }
-
-// cleans up previous installs
-// @improvement could keep n previous versions?
-func removeExistingVersions(installDir string) error {
-	if !path.IsAbs(installDir) {
-		// since we're removing a whole dir here, lets be careful that no-one has put ../../../ in the config etc
-		panic("removeExistingVersions was passed a non-absoulte path. This shouldn't happen!")
-	}
-	if err := os.RemoveAll(installDir); err != nil {
-		return err
-	}
-	if err := os.MkdirAll(installDir, 0755); err != nil {
-		return err
-	}
-	return nil
-}
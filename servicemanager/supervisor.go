@@ -0,0 +1,181 @@
+package servicemanager
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"sync"
+	"time"
+
+	"sm2/ledger"
+)
+
+// initialBackoff is the first restart delay after a crash.
+const initialBackoff = 1 * time.Second
+
+// maxBackoff caps how long the supervisor will wait between restart attempts.
+const maxBackoff = 1 * time.Minute
+
+// stableThreshold is how long a process has to stay up before a subsequent
+// crash is treated as a fresh failure rather than a continuation of a
+// crash loop, resetting the backoff back to initialBackoff.
+const stableThreshold = 5 * time.Second
+
+// supervisorStops tracks the "hand off this service" channel for each
+// currently-supervised service, keyed by Service.Id. Whenever something
+// outside the supervisor loop (the updater, a rollback, an
+// unhealthy-restart) kills a service's pid out from under it via
+// safeStop, it closes the channel here first so the supervisor goroutine
+// watching that pid sees it and steps aside instead of "crash"-restarting
+// the version it was started with, racing the new process that's about to
+// take the same port.
+var supervisorStops sync.Map
+
+// registerSupervisor creates and records a fresh stop channel for a
+// service, replacing whatever was registered for a previous generation of
+// the process. It must be called before spawning the supervisor goroutine
+// that watches cmd.
+func registerSupervisor(serviceId string) <-chan struct{} {
+	stop := make(chan struct{})
+	supervisorStops.Store(serviceId, stop)
+	return stop
+}
+
+// stopSupervisor signals the currently-registered supervisor goroutine (if
+// any) for a service to stop watching its process, and forgets it.
+func stopSupervisor(serviceId string) {
+	if v, ok := supervisorStops.LoadAndDelete(serviceId); ok {
+		close(v.(chan struct{}))
+	}
+}
+
+// supervise watches cmd until it exits and, while sm.Commands.Supervise is
+// set, restarts the service with an exponential backoff whenever it exits
+// non-zero. Restart counts and exit info are tracked in the ledger's
+// StateFile so `sm2 status` can show how flappy a service has been. stop
+// is closed by stopSupervisor when something else is taking over this
+// process (an update, rollback, or unhealthy-restart), at which point
+// supervise steps aside instead of resurrecting it.
+func (sm ServiceManager) supervise(service Service, installFile ledger.InstallFile, installDir string, cmd *exec.Cmd, stop <-chan struct{}) {
+
+	backoff := initialBackoff
+
+	for {
+		exited := make(chan error, 1)
+		go func(c *exec.Cmd) { exited <- c.Wait() }(cmd)
+
+		startedAt := time.Now()
+		var err error
+		select {
+		case err = <-exited:
+		case <-stop:
+			// someone else has taken over this service's lifecycle
+			return
+		}
+		ranFor := time.Since(startedAt)
+
+		if ranFor >= stableThreshold {
+			backoff = initialBackoff
+		}
+
+		exitCode := 0
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				exitCode = exitErr.ExitCode()
+			} else {
+				exitCode = -1
+			}
+		}
+
+		state, loadErr := sm.Ledger.LoadStateFile(installDir)
+		if loadErr != nil {
+			state = ledger.StateFile{}
+		}
+		state.LastExit = time.Now()
+		state.LastExitCode = exitCode
+
+		if exitCode == 0 {
+			sm.Ledger.SaveStateFile(installDir, state)
+			return
+		}
+
+		state.Restarts++
+		sm.Ledger.SaveStateFile(installDir, state)
+		sm.UiUpdates <- Progress{service: service.Id, state: "Crashed, restarting..."}
+
+		// retry sm.restart itself on its own backoff until it produces a
+		// live cmd - looping back to the top and Wait()ing on the same cmd
+		// again after a failed restart attempt would just return
+		// "Wait was already called" instead of actually waiting.
+		var restarted restartedProcess
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(backoff):
+			}
+
+			removeRunningPid(installFile.Path)
+
+			var restartErr error
+			restarted, restartErr = sm.restart(service, installFile, state)
+			if restartErr != nil {
+				sm.UiUpdates <- Progress{service: service.Id, state: "Supervised restart failed: " + restartErr.Error()}
+				backoff = nextBackoff(backoff)
+				continue
+			}
+			break
+		}
+
+		sm.Ledger.SaveStateFile(installDir, restarted.state)
+		cmd = restarted.cmd
+		backoff = nextBackoff(backoff)
+	}
+}
+
+type restartedProcess struct {
+	cmd   *exec.Cmd
+	state ledger.StateFile
+}
+
+// restart re-execs the service binary, reopening logs/stdout.log in append
+// mode so restart output lands after the previous run's instead of
+// clobbering it.
+func (sm ServiceManager) restart(service Service, installFile ledger.InstallFile, previous ledger.StateFile) (restartedProcess, error) {
+	args, logFile, err := sm.prepareRun(service, installFile, previous.Port, true)
+	if err != nil {
+		return restartedProcess{}, err
+	}
+
+	_, runCmd := path.Split(service.Binary.Cmd[0])
+	cmd := exec.Command(path.Join(installFile.Path, "bin", runCmd), args...)
+	cmd.Dir = installFile.Path
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+
+	if err := cmd.Start(); err != nil {
+		return restartedProcess{}, err
+	}
+
+	state := previous
+	state.Pid = cmd.Process.Pid
+	state.Started = time.Now()
+	state.Args = args
+
+	return restartedProcess{cmd: cmd, state: state}, nil
+}
+
+func nextBackoff(current time.Duration) time.Duration {
+	next := current * 2
+	if next > maxBackoff {
+		return maxBackoff
+	}
+	return next
+}
+
+// reopenStdout opens logs/stdout.log in append mode so a supervised restart
+// keeps writing to the same file instead of clobbering the previous run's
+// output.
+func reopenStdout(serviceDir string) (*os.File, error) {
+	return os.OpenFile(path.Join(serviceDir, "logs", "stdout.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+}
@@ -0,0 +1,83 @@
+//go:build linux
+
+package servicemanager
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"sm2/ledger"
+)
+
+// runManaged launches service as a transient systemd user unit (instead of
+// sm2 spawning and supervising a bare child process), giving it systemd's
+// own crash-recovery and keeping it running across an sm2 restart.
+func (sm ServiceManager) runManaged(service Service, installFile ledger.InstallFile, portNumber int) (ledger.StateFile, error) {
+	args := sm.buildArgs(service, installFile, portNumber)
+
+	if err := runAsSystemdUnit(service, installFile, args); err != nil {
+		return ledger.StateFile{}, err
+	}
+
+	return ledger.StateFile{
+		Service:  service.Id,
+		Artifact: service.Binary.Artifact,
+		Version:  installFile.Version,
+		Path:     installFile.Path,
+		Md5Sum:   installFile.Md5Sum,
+		Started:  time.Now(),
+		Port:     portNumber,
+		Args:     args,
+		Backend:  BackendSystemdUnit,
+	}, nil
+}
+
+// runAsSystemdUnit launches the service as a transient systemd user unit
+// instead of a bare child process, via `systemd-run --user`. This gives
+// the service manager's own crash-recovery out of the box and keeps the
+// process running across an sm2 restart without needing AdoptOrphans to
+// find it by marker.
+func runAsSystemdUnit(service Service, installFile ledger.InstallFile, args []string) error {
+	_, runCmd := path.Split(service.Binary.Cmd[0])
+	binPath := path.Join(installFile.Path, "bin", runCmd)
+
+	unitName := fmt.Sprintf("sm2-%s", service.Id)
+	systemdArgs := append([]string{
+		"--user",
+		"--unit=" + unitName,
+		"--working-directory=" + installFile.Path,
+		"--collect",
+		"--property=Restart=on-failure",
+		binPath,
+	}, args...)
+
+	cmd := exec.Command("systemd-run", systemdArgs...)
+	return cmd.Run()
+}
+
+// stopManaged dispatches safeStop's teardown for a service that wasn't
+// started as a bare child process. BackendWindowsSvc doesn't exist on
+// this platform, so stopWindowsService was never compiled in - anything
+// other than BackendSystemdUnit is a bug in how the StateFile got tagged.
+func stopManaged(backend ServiceBackend, serviceId string) error {
+	switch backend {
+	case BackendSystemdUnit:
+		return stopSystemdUnit(serviceId)
+	default:
+		return fmt.Errorf("unknown service backend %q on linux", backend)
+	}
+}
+
+// stopSystemdUnit stops and cleans up the transient unit created for a
+// service, used by safeStop instead of killing a pid directly.
+func stopSystemdUnit(serviceId string) error {
+	unitName := fmt.Sprintf("sm2-%s.service", serviceId)
+	cmd := exec.Command("systemctl", "--user", "stop", unitName)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to stop %s: %s: %s", unitName, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package servicemanager
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"sm2/ledger"
+)
+
+// defaultCheckInterval is how often the updater polls artifactory for newer
+// versions when the user hasn't supplied --update-interval.
+const defaultCheckInterval = 15 * time.Minute
+
+// minCheckInterval stops users from hammering artifactory with a too-short interval.
+const minCheckInterval = 1 * time.Minute
+
+// RunUpdater starts a blocking loop that periodically checks every running
+// service for a newer version and, if one is found, installs and restarts it.
+// It's intended to be launched as its own goroutine from StartService (or from
+// a standalone `sm2 update --watch` invocation) and runs until stop is closed.
+func (sm ServiceManager) RunUpdater(stop <-chan struct{}) {
+
+	interval := sm.Commands.UpdateInterval
+	if interval == 0 {
+		interval = defaultCheckInterval
+	} else if interval < minCheckInterval {
+		interval = minCheckInterval
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(jitter(interval)):
+			sm.checkForUpdates()
+		}
+	}
+}
+
+// checkForUpdates compares every running service's installed version
+// against the latest one available in artifactory and upgrades any that
+// are stale. Pinned services and services that aren't running are skipped.
+func (sm ServiceManager) checkForUpdates() {
+	for name, service := range sm.Services {
+		if pinned, ok := sm.Commands.PinnedVersions[name]; ok {
+			sm.PrintVerbose(fmt.Sprintf("%s is pinned to %s, skipping update check", name, pinned))
+			continue
+		}
+
+		if err := sm.updateServiceIfStale(name, service); err != nil {
+			sm.UiUpdates <- Progress{service: name, state: fmt.Sprintf("Update check failed: %s", err)}
+		}
+	}
+}
+
+func (sm ServiceManager) updateServiceIfStale(name string, service Service) error {
+	installDir, _ := sm.findInstallDirOfService(name)
+
+	installFile, err := sm.Ledger.LoadInstallFile(installDir)
+	if err != nil {
+		// not installed, nothing for the updater to do
+		return nil
+	}
+
+	stateFile, err := sm.Ledger.LoadStateFile(installDir)
+	if err != nil {
+		// not currently running, leave it for StartService to pick up
+		return nil
+	}
+
+	versions, err := sm.GetLatestVersions(service.Binary)
+	if err != nil {
+		return fmt.Errorf("no version found: %s", err)
+	}
+
+	if versions.Latest == installFile.Version {
+		return nil
+	}
+
+	sm.UiUpdates <- Progress{service: name, state: fmt.Sprintf("Updating to %s...", versions.Latest)}
+
+	newInstallFile, err := sm.installService(installDir, service, versions.Latest)
+	if err != nil {
+		return err
+	}
+	newInstallFile.PreviousVersion = installFile.Version
+	newInstallFile.UpdatedAt = time.Now()
+
+	if err := sm.safeStop(stateFile); err != nil {
+		return fmt.Errorf("failed to stop %s before swapping version: %s", name, err)
+	}
+
+	if err := sm.Ledger.SaveInstallFile(installDir, newInstallFile); err != nil {
+		return err
+	}
+
+	state, err := sm.run(service, newInstallFile, installDir)
+	if err != nil {
+		return err
+	}
+
+	return sm.Ledger.SaveStateFile(installDir, state)
+}
+
+// safeStop stops a running service and waits (up to 30s, for pid-backed
+// services) for it to actually exit. On Unix the wait only blocks when
+// the pid is a child of this sm2 process; for any other pid proc.Wait
+// returns at once. updateServiceIfStale calls it after installService,
+// which has already saved the new InstallFile and moved current to the
+// new version. It's the one choke point every caller that tears
+// down a running service (the updater, sm2 rollback, an
+// unhealthy-restart) goes through, so it also signals any supervisor
+// goroutine watching this pid to step aside first - otherwise that
+// goroutine sees the kill as a crash and resurrects the old
+// version/process racing the new one the caller is about to start. A
+// service started via --as-service is handed off to its backend's own
+// stop instead of being killed directly: mgr.Control(svc.Stop) on
+// windows-service, systemctl --user stop on systemd-unit.
+func (sm ServiceManager) safeStop(state ledger.StateFile) error {
+	stopSupervisor(state.Service)
+
+	if state.Backend != "" && state.Backend != BackendProcess {
+		return stopManaged(state.Backend, state.Service)
+	}
+
+	proc, err := os.FindProcess(state.Pid)
+	if err != nil {
+		// already gone, nothing to wait for
+		return nil
+	}
+
+	if err := proc.Kill(); err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		proc.Wait()
+		close(exited)
+	}()
+
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(30 * time.Second):
+		return fmt.Errorf("timed out waiting for pid %d to exit", state.Pid)
+	}
+}
+
+// jitter returns d plus or minus up to 10%, so that a fleet of services
+// restarted at the same moment don't all poll artifactory in lockstep.
+func jitter(d time.Duration) time.Duration {
+	spread := float64(d) * 0.1
+	offset := (rand.Float64()*2 - 1) * spread
+	return d + time.Duration(offset)
+}
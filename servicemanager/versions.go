@@ -0,0 +1,120 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+
+	"sm2/ledger"
+)
+
+// defaultKeepVersions is how many installs we leave on disk, the current one
+// included, so a rollback doesn't need a re-download.
+const defaultKeepVersions = 3
+
+// currentLinkName is the pointer that always resolves to the serviceDir of
+// whichever version is live. On Windows this is a current.json pointer
+// file rather than a symlink, since os.Symlink there needs elevated
+// privileges by default.
+const currentLinkName = "current"
+
+// updateCurrentSymlink points installDir/current (installDir/current.json
+// on Windows) at serviceDir, replacing whatever it pointed at before.
+func updateCurrentSymlink(installDir string, serviceDir string) error {
+	if runtime.GOOS == "windows" {
+		pointer, err := json.Marshal(map[string]string{"path": serviceDir})
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path.Join(installDir, currentLinkName+".json"), pointer, 0644)
+	}
+
+	current := path.Join(installDir, currentLinkName)
+	os.Remove(current)
+	return os.Symlink(serviceDir, current)
+}
+
+// gcOldVersions keeps the most recent `keep` installed versions of a
+// service (by InstallFile.Created) and removes the rest from disk, so that
+// repeated upgrades don't grow installDir without bound while still
+// leaving enough history for `sm2 rollback` to be useful.
+func (sm ServiceManager) gcOldVersions(installDir string, keep int) error {
+	installFiles, err := sm.Ledger.ListInstallFiles(installDir)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(installFiles, func(i, j int) bool {
+		return installFiles[i].Created.After(installFiles[j].Created)
+	})
+
+	if len(installFiles) <= keep {
+		return nil
+	}
+
+	for _, stale := range installFiles[keep:] {
+		if err := os.RemoveAll(path.Join(installDir, stale.Version)); err != nil {
+			return err
+		}
+		if err := sm.Ledger.DeleteInstallFileVersion(installDir, stale.Version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RollbackService stops a running service and restarts it against the
+// previous InstallFile, making recovery from a bad upgrade a 1-command
+// operation rather than a re-download.
+func (sm ServiceManager) RollbackService(serviceName string) error {
+	service, ok := sm.Services[serviceName]
+	if !ok {
+		return fmt.Errorf("%s is not a valid service", serviceName)
+	}
+
+	installDir, _ := sm.findInstallDirOfService(serviceName)
+
+	installFiles, err := sm.Ledger.ListInstallFiles(installDir)
+	if err != nil {
+		return fmt.Errorf("%s has no install history to roll back to", serviceName)
+	}
+
+	current, err := sm.Ledger.LoadInstallFile(installDir)
+	if err != nil {
+		return fmt.Errorf("%s is not currently installed", serviceName)
+	}
+
+	sort.Slice(installFiles, func(i, j int) bool {
+		return installFiles[i].Created.After(installFiles[j].Created)
+	})
+
+	var previous *ledger.InstallFile
+	for i, f := range installFiles {
+		if f.Version == current.Version && i+1 < len(installFiles) {
+			previous = &installFiles[i+1]
+			break
+		}
+	}
+	if previous == nil {
+		return fmt.Errorf("no previous version of %s to roll back to", serviceName)
+	}
+
+	if state, err := sm.Ledger.LoadStateFile(installDir); err == nil {
+		if err := sm.safeStop(state); err != nil {
+			return fmt.Errorf("failed to stop %s before rolling back: %s", serviceName, err)
+		}
+	}
+
+	if err := updateCurrentSymlink(installDir, previous.Path); err != nil {
+		return err
+	}
+	if err := sm.Ledger.SaveInstallFile(installDir, *previous); err != nil {
+		return err
+	}
+
+	return sm.startFromInstallFile(serviceName, service, installDir, *previous)
+}
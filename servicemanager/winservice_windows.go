@@ -0,0 +1,222 @@
+//go:build windows
+
+package servicemanager
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"sm2/ledger"
+)
+
+// winServiceRecoveryActions restarts a crashed Windows service after 5s for
+// the first two failures, then backs off to 30s - the recovery schedule
+// requested for --as-service.
+var winServiceRecoveryActions = []mgr.RecoveryAction{
+	{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+	{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+	{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+}
+
+// runManaged registers service with the SCM (instead of sm2 spawning and
+// supervising a bare child process) so it survives the invoking user
+// logging out and gets restarted by Windows itself if it, or sm2, crashes.
+func (sm ServiceManager) runManaged(service Service, installFile ledger.InstallFile, portNumber int) (ledger.StateFile, error) {
+	if err := sm.installAsWindowsService(service, installFile, portNumber); err != nil {
+		return ledger.StateFile{}, err
+	}
+
+	return ledger.StateFile{
+		Service:  service.Id,
+		Artifact: service.Binary.Artifact,
+		Version:  installFile.Version,
+		Path:     installFile.Path,
+		Md5Sum:   installFile.Md5Sum,
+		Started:  time.Now(),
+		Port:     portNumber,
+		Backend:  BackendWindowsSvc,
+	}, nil
+}
+
+// windowsServiceWrapperFlag is the argv[1] sm2 re-execs itself with when
+// the SCM starts a service installed via --as-service. A process the SCM
+// launches has to call StartServiceCtrlDispatcher (what svc.Run wraps)
+// within the startup timeout or Windows kills it as unresponsive - an
+// arbitrary service binary won't do that, so the SCM entry has to point
+// back at sm2 itself. main must check os.Args[1] for this flag before any
+// other CLI dispatch and, if present, hand off to RunWindowsServiceWrapper
+// instead.
+const windowsServiceWrapperFlag = "--windows-service-wrapper"
+
+// installAsWindowsService registers service with the SCM so it survives
+// the invoking user logging out and gets restarted by Windows itself if
+// it (or sm2) crashes. It's used by `sm2 install-service <name>` and by
+// runManaged when --as-service is passed. The SCM entry points at sm2's
+// own executable, re-exec'd with windowsServiceWrapperFlag, rather than at
+// the service binary directly - RunWindowsServiceWrapper is what actually
+// builds the command line (via sm.buildArgs, so it still gets its port,
+// service-manager marker and any --extra-args) and wraps it with
+// runAsWindowsService so the SCM gets its StartServiceCtrlDispatcher call.
+func (sm ServiceManager) installAsWindowsService(service Service, installFile ledger.InstallFile, portNumber int) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service control manager: %s", err)
+	}
+	defer m.Disconnect()
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to resolve sm2's own executable path: %s", err)
+	}
+
+	s, err := m.CreateService(service.Id, self, mgr.Config{
+		DisplayName: service.Id,
+		StartType:   mgr.StartAutomatic,
+	}, windowsServiceWrapperFlag, service.Id, fmt.Sprintf("%d", portNumber))
+	if err != nil {
+		return fmt.Errorf("failed to create windows service %s: %s", service.Id, err)
+	}
+	defer s.Close()
+
+	if err := s.SetRecoveryActions(winServiceRecoveryActions, 24*time.Hour); err != nil {
+		return fmt.Errorf("failed to configure recovery actions for %s: %s", service.Id, err)
+	}
+
+	return s.Start()
+}
+
+// RunWindowsServiceWrapper is what main hands off to when sm2 is re-exec'd
+// with windowsServiceWrapperFlag by the SCM. It builds the service's own
+// command line from the service id and port that installAsWindowsService
+// registered as arguments, and hands it to runAsWindowsService instead of
+// starting it directly.
+func (sm ServiceManager) RunWindowsServiceWrapper(serviceId string, portNumber int) error {
+	service, ok := sm.Services[serviceId]
+	if !ok {
+		return fmt.Errorf("%s is not a valid service", serviceId)
+	}
+
+	installDir, _ := sm.findInstallDirOfService(serviceId)
+	installFile, err := sm.Ledger.LoadInstallFile(installDir)
+	if err != nil {
+		return fmt.Errorf("%s is not installed: %s", serviceId, err)
+	}
+
+	args := sm.buildArgs(service, installFile, portNumber)
+	_, runCmd := path.Split(service.Binary.Cmd[0])
+	cmd := exec.Command(path.Join(installFile.Path, "bin", runCmd), args...)
+	cmd.Dir = installFile.Path
+
+	logFile, err := os.Create(path.Join(installFile.Path, "logs", "stdout.log"))
+	if err != nil {
+		return fmt.Errorf("failed to open stdout log for %s: %s", serviceId, err)
+	}
+
+	return runAsWindowsService(serviceId, cmd, logFile)
+}
+
+// UninstallWindowsService stops and removes a previously-registered
+// windows-service backed service, for `sm2 uninstall-service <name>`.
+func UninstallWindowsService(serviceId string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service control manager: %s", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceId)
+	if err != nil {
+		return fmt.Errorf("%s is not registered as a windows service: %s", serviceId, err)
+	}
+	defer s.Close()
+
+	if _, err := s.Control(svc.Stop); err != nil {
+		sm2Verbose(fmt.Sprintf("stop of %s returned: %s (continuing with delete)", serviceId, err))
+	}
+
+	return s.Delete()
+}
+
+// stopManaged dispatches safeStop's teardown for a service that wasn't
+// started as a bare child process. BackendSystemdUnit doesn't exist on
+// this platform, so stopSystemdUnit was never compiled in - anything
+// other than BackendWindowsSvc is a bug in how the StateFile got tagged.
+func stopManaged(backend ServiceBackend, serviceId string) error {
+	switch backend {
+	case BackendWindowsSvc:
+		return stopWindowsService(serviceId)
+	default:
+		return fmt.Errorf("unknown service backend %q on windows", backend)
+	}
+}
+
+// stopWindowsService asks the SCM to stop a windows-service backed
+// service, used by safeStop instead of killing a pid directly.
+func stopWindowsService(serviceId string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service control manager: %s", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceId)
+	if err != nil {
+		return fmt.Errorf("%s is not registered as a windows service: %s", serviceId, err)
+	}
+	defer s.Close()
+
+	_, err = s.Control(svc.Stop)
+	return err
+}
+
+// sm2Verbose is a tiny package-level logger for the windows-service path,
+// which runs without a ServiceManager instance available (service wrapper
+// entry point, uninstall path).
+func sm2Verbose(msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+}
+
+// winServiceHandler implements svc.Handler, redirecting the wrapped
+// command's stdout/stderr to logs/stdout.log and forwarding SCM stop
+// requests on to it.
+type winServiceHandler struct {
+	cmd *exec.Cmd
+}
+
+func (h *winServiceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	if err := h.cmd.Start(); err != nil {
+		return true, 1
+	}
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for req := range requests {
+		switch req.Cmd {
+		case svc.Stop, svc.Shutdown:
+			changes <- svc.Status{State: svc.StopPending}
+			h.cmd.Process.Kill()
+			h.cmd.Wait()
+			return false, 0
+		}
+	}
+
+	return false, 0
+}
+
+// runAsWindowsService is called by RunWindowsServiceWrapper, in the sm2
+// process the SCM starts for a service installed via --as-service - it
+// blocks for the lifetime of the service, handing control to the SCM.
+func runAsWindowsService(serviceId string, cmd *exec.Cmd, logFile *os.File) error {
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+
+	return svc.Run(serviceId, &winServiceHandler{cmd: cmd})
+}